@@ -0,0 +1,17 @@
+package auth
+
+// AdminCommand identifies an action an admin session may request from
+// the quizz server.
+type AdminCommand string
+
+// Admin commands available to fingerprints registered in AuthStore.
+const (
+	CommandKick       AdminCommand = "kick"
+	CommandBan        AdminCommand = "ban"
+	CommandChangeQuiz AdminCommand = "change-quiz"
+	// CommandList lists the identity keys of the lobby's players,
+	// including those whose connection has dropped, next to their
+	// display names, so an admin can find the key to target with
+	// CommandKick/CommandBan.
+	CommandList AdminCommand = "list"
+)
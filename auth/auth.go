@@ -0,0 +1,164 @@
+// Package auth handles player identity and access control for the quizz
+// server: which SSH public keys are allowed to connect, which
+// fingerprints/IPs/usernames are temporarily banned, and which
+// fingerprints carry admin privileges.
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthStore tracks the allowlist, banlist and admin fingerprints used to
+// authenticate and authorize incoming SSH connections.
+type AuthStore struct {
+	mux sync.RWMutex
+
+	allowlistEnabled bool
+	allowlist        map[string]bool
+
+	bans map[string]time.Time
+
+	admins map[string]bool
+}
+
+// NewAuthStore returns an AuthStore with no allowlist (anyone may
+// connect, subject to the banlist) and the given admin fingerprints.
+func NewAuthStore(adminFingerprints []string) *AuthStore {
+	admins := make(map[string]bool, len(adminFingerprints))
+	for _, fp := range adminFingerprints {
+		admins[fp] = true
+	}
+
+	return &AuthStore{
+		allowlist: make(map[string]bool),
+		bans:      make(map[string]time.Time),
+		admins:    admins,
+	}
+}
+
+// LoadAllowlist reads a file of one SSH key fingerprint per line
+// (blank lines and lines starting with "#" are ignored) and enables the
+// allowlist: once loaded, only connections whose fingerprint appears in
+// the file are accepted.
+func (s *AuthStore) LoadAllowlist(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("auth: failed to open allowlist: %w", err)
+	}
+	defer f.Close()
+
+	allowlist := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		allowlist[line] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("auth: failed to read allowlist: %w", err)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.allowlist = allowlist
+	s.allowlistEnabled = true
+	return nil
+}
+
+// AllowlistEnabled reports whether an allowlist has been loaded. Callers
+// that can't produce a fingerprint (e.g. the keyboard-interactive,
+// no-auth fallback) must refuse the connection while this is true,
+// since there's no fingerprint to check the allowlist against.
+func (s *AuthStore) AllowlistEnabled() bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.allowlistEnabled
+}
+
+// IsAllowed reports whether fingerprint may connect. When no allowlist
+// has been loaded, every fingerprint is allowed.
+func (s *AuthStore) IsAllowed(fingerprint string) bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	if !s.allowlistEnabled {
+		return true
+	}
+	return s.allowlist[fingerprint]
+}
+
+// IsAdmin reports whether fingerprint has been granted admin commands
+// (kick, ban, change quiz).
+func (s *AuthStore) IsAdmin(fingerprint string) bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.admins[fingerprint]
+}
+
+// Ban blocks key (a fingerprint, IP or username) for the given
+// duration. A duration of zero bans the key forever.
+func (s *AuthStore) Ban(key string, duration time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var expiresAt time.Time
+	if duration > 0 {
+		expiresAt = time.Now().Add(duration)
+	}
+	s.bans[key] = expiresAt
+}
+
+// Unban lifts a ban previously set on key.
+func (s *AuthStore) Unban(key string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.bans, key)
+}
+
+// IsBanned reports whether key is currently banned, lazily evicting the
+// entry once it has expired.
+func (s *AuthStore) IsBanned(key string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	expiresAt, ok := s.bans[key]
+	if !ok {
+		return false
+	}
+	if expiresAt.IsZero() {
+		return true
+	}
+	if time.Now().After(expiresAt) {
+		delete(s.bans, key)
+		return false
+	}
+	return true
+}
+
+// Authenticate reports whether a client identified by fingerprint,
+// username and remoteAddr may connect: it must not be banned under any
+// of the three, and, if an allowlist is in use, the fingerprint must be
+// on it. remoteAddr may be a bare IP or a host:port address; only its
+// host part is checked against the banlist. It is transport-agnostic so
+// any SSH server implementation can drive it from its own public-key
+// callback.
+func (s *AuthStore) Authenticate(fingerprint, username, remoteAddr string) bool {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	if s.IsBanned(fingerprint) || s.IsBanned(username) || s.IsBanned(remoteAddr) {
+		return false
+	}
+	return s.IsAllowed(fingerprint)
+}
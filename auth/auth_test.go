@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIsBannedExpiry(t *testing.T) {
+	store := NewAuthStore(nil)
+
+	if store.IsBanned("fp") {
+		t.Fatalf("IsBanned(fp) = true before any ban, want false")
+	}
+
+	store.Ban("fp", 0)
+	if !store.IsBanned("fp") {
+		t.Fatalf("IsBanned(fp) = false after a permanent ban, want true")
+	}
+
+	store.Unban("fp")
+	if store.IsBanned("fp") {
+		t.Fatalf("IsBanned(fp) = true after Unban, want false")
+	}
+
+	store.bans["expired"] = time.Now().Add(-time.Second)
+	if store.IsBanned("expired") {
+		t.Fatalf("IsBanned(expired) = true for a ban whose expiry has passed, want false")
+	}
+	if _, stillPresent := store.bans["expired"]; stillPresent {
+		t.Fatalf("expired ban was not evicted from store.bans")
+	}
+
+	store.bans["future"] = time.Now().Add(time.Minute)
+	if !store.IsBanned("future") {
+		t.Fatalf("IsBanned(future) = false for a ban that hasn't expired yet, want true")
+	}
+}
+
+func TestAuthenticatePrecedence(t *testing.T) {
+	store := NewAuthStore(nil)
+
+	if !store.Authenticate("fp", "alice", "1.2.3.4") {
+		t.Fatalf("Authenticate = false with no bans or allowlist, want true")
+	}
+
+	store.Ban("fp", 0)
+	if store.Authenticate("fp", "alice", "1.2.3.4") {
+		t.Fatalf("Authenticate = true for a banned fingerprint, want false")
+	}
+	store.Unban("fp")
+
+	store.Ban("alice", 0)
+	if store.Authenticate("fp", "alice", "1.2.3.4") {
+		t.Fatalf("Authenticate = true for a banned username, want false")
+	}
+	store.Unban("alice")
+
+	store.Ban("1.2.3.4", 0)
+	if store.Authenticate("fp", "alice", "1.2.3.4") {
+		t.Fatalf("Authenticate = true for a banned remote address, want false")
+	}
+	store.Unban("1.2.3.4")
+
+	if err := store.LoadAllowlist(writeAllowlist(t, "other-fp\n")); err != nil {
+		t.Fatalf("LoadAllowlist: %v", err)
+	}
+	if store.Authenticate("fp", "alice", "1.2.3.4") {
+		t.Fatalf("Authenticate = true for a fingerprint not on the allowlist, want false")
+	}
+	if !store.Authenticate("other-fp", "alice", "1.2.3.4") {
+		t.Fatalf("Authenticate = false for a fingerprint on the allowlist, want true")
+	}
+}
+
+// writeAllowlist writes contents to a temp file and returns its path,
+// for LoadAllowlist to read back.
+func writeAllowlist(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "allowlist")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("failed to write allowlist fixture: %v", err)
+	}
+	return path
+}
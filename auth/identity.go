@@ -0,0 +1,27 @@
+package auth
+
+// PlayerIdentity is the stable identity of a connecting player. A
+// player who authenticates with a public key is identified by its
+// Fingerprint; a player with no SSH keypair configured falls back to
+// the server's keyboard-interactive, no-auth mode, and is identified
+// instead by a client-supplied Passphrase. Exactly one of the two is
+// set. The lobby passphrase in a player's username (see ParseLobbyCode)
+// only picks which lobby they join, not who they are - a different
+// thing from this Passphrase.
+type PlayerIdentity struct {
+	Fingerprint string
+	Passphrase  string
+	Username    string
+	RemoteAddr  string
+	Admin       bool
+}
+
+// Key returns the string PlayerSession map entries should be keyed by:
+// the key fingerprint when one is available, otherwise "guest:"
+// followed by the passphrase supplied over keyboard-interactive auth.
+func (p PlayerIdentity) Key() string {
+	if p.Fingerprint != "" {
+		return p.Fingerprint
+	}
+	return "guest:" + p.Passphrase
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yageek/term-quizz/auth"
+	"github.com/yageek/term-quizz/metrics"
+)
+
+// gameState is the phase a QuizzServer's game loop is in.
+type gameState int
+
+const (
+	// stateLobby waits for players to join before the first question.
+	stateLobby gameState = iota
+	// stateQuestion is showing a question and accepting answers.
+	stateQuestion
+	// stateReveal shows the correct answer and leaderboard between questions.
+	stateReveal
+	// stateEnded shows final results, then optionally chains to nextQuizz.
+	stateEnded
+)
+
+const (
+	// lobbyCountdown is how long the lobby waits, once the first player
+	// has joined, before the first question starts.
+	lobbyCountdown = 10 * time.Second
+	// revealDuration is how long the correct answer and leaderboard are
+	// shown between questions.
+	revealDuration = 5 * time.Second
+	// resultsDuration is how long the final results screen is shown
+	// before chaining to nextQuizz, if one is set.
+	resultsDuration = 15 * time.Second
+)
+
+// GameSnapshot is the read-only view of a QuizzServer's game state that
+// PlayerScreen needs to render a single frame.
+type GameSnapshot struct {
+	Quizz         *Quizz
+	State         gameState
+	QuestionIndex int
+	TimeLeft      time.Duration
+	Leaderboard   []LeaderboardEntry
+}
+
+// LeaderboardEntry is one player's standing on the leaderboard panel.
+type LeaderboardEntry struct {
+	Name  string
+	Score int
+}
+
+// advance runs the game state machine forward to now. Callers must hold q.mux.
+func (q *QuizzServer) advance(now time.Time) {
+	switch q.state {
+	case stateLobby:
+		q.advanceLobby(now)
+	case stateQuestion:
+		if !now.Before(q.questionDeadline) {
+			q.state = stateReveal
+		}
+	case stateReveal:
+		if !now.Before(q.questionDeadline.Add(revealDuration)) {
+			q.advanceAfterReveal(now)
+		}
+	case stateEnded:
+		q.advanceEnded(now)
+	}
+}
+
+func (q *QuizzServer) advanceLobby(now time.Time) {
+	if len(q.Sessions) == 0 {
+		q.lobbyDeadline = time.Time{}
+		return
+	}
+	if q.lobbyDeadline.IsZero() {
+		q.lobbyDeadline = now.Add(lobbyCountdown)
+		return
+	}
+	if now.Before(q.lobbyDeadline) {
+		return
+	}
+	q.startQuestion(now, 0)
+}
+
+func (q *QuizzServer) advanceAfterReveal(now time.Time) {
+	next := q.questionIndex + 1
+	if q.currentQuizz == nil || next >= len(q.currentQuizz.Questions) {
+		q.state = stateEnded
+		q.endedAt = now
+		return
+	}
+	q.startQuestion(now, next)
+}
+
+func (q *QuizzServer) advanceEnded(now time.Time) {
+	if q.nextQuizz == nil {
+		return
+	}
+	if now.Before(q.endedAt.Add(resultsDuration)) {
+		return
+	}
+
+	// nextQuizz may lock q.mux itself (e.g. through QuizzTitle), so it
+	// runs with q.mux released.
+	fn := q.nextQuizz
+	q.mux.Unlock()
+	next := fn()
+	q.mux.Lock()
+	if next == nil || q.state != stateEnded {
+		// Nothing to chain to, or the quizz was changed meanwhile: stay.
+		return
+	}
+	q.setQuizzLocked(next)
+}
+
+func (q *QuizzServer) startQuestion(now time.Time, index int) {
+	q.state = stateQuestion
+	q.questionIndex = index
+	q.questionStartedAt = now
+	q.questionDeadline = now.Add(q.currentQuizz.Questions[index].Timeout)
+}
+
+// snapshotLocked builds the GameSnapshot for the current instant.
+// Callers must hold q.mux.
+func (q *QuizzServer) snapshotLocked(now time.Time) GameSnapshot {
+	snapshot := GameSnapshot{
+		Quizz:         q.currentQuizz,
+		State:         q.state,
+		QuestionIndex: q.questionIndex,
+		Leaderboard:   q.leaderboardLocked(),
+	}
+
+	switch q.state {
+	case stateQuestion:
+		snapshot.TimeLeft = q.questionDeadline.Sub(now)
+	case stateLobby:
+		if !q.lobbyDeadline.IsZero() {
+			snapshot.TimeLeft = q.lobbyDeadline.Sub(now)
+		}
+	}
+
+	return snapshot
+}
+
+// leaderboardLocked returns every session's standing, highest score
+// first. Callers must hold q.mux.
+func (q *QuizzServer) leaderboardLocked() []LeaderboardEntry {
+	entries := make([]LeaderboardEntry, 0, len(q.Sessions))
+	for _, session := range q.Sessions {
+		entries = append(entries, session.leaderboardEntry())
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Score > entries[j].Score })
+	return entries
+}
+
+// readAnswers reads one keystroke at a time from channel for the
+// lifetime of the connection, submitting a-d/1-4 keystrokes as answers
+// for key's session. If isAdmin, a line starting with "!" is instead
+// parsed and run as an admin command (see handleAdminCommand), with any
+// reply written back to channel. It returns once channel is closed or
+// errors.
+func (q *QuizzServer) readAnswers(key string, isAdmin bool, channel io.ReadWriter) {
+	reader := bufio.NewReader(channel)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+
+		if isAdmin && b == '!' {
+			line, err := reader.ReadString('\r')
+			if err != nil {
+				return
+			}
+			q.handleAdminCommand(channel, strings.TrimSpace(strings.Trim(line, "\r\n")))
+			continue
+		}
+
+		if answer, ok := answerKeyForKeystroke(b); ok {
+			q.SubmitAnswer(key, answer)
+		}
+	}
+}
+
+// handleAdminCommand parses and runs one admin command line, of the
+// form "<command> [target]": "kick <key>" and "ban <key>" act on the
+// player whose identity key (see PlayerIdentity.Key) matches exactly -
+// never the display name, which is attacker-controlled and can collide
+// between players - "list" writes the key of every player session this
+// lobby holds (including players whose connection has dropped) next to
+// their display name to reply, so an admin can find the key to target,
+// "change-quiz <path>" loads and switches to the quizz definition at
+// path (see QuizzServer.LoadFromFile), reporting any error to reply,
+// and a bare "change-quiz" chains to nextQuizz immediately instead of
+// waiting out resultsDuration. Unknown commands and commands with a
+// missing target are ignored. Callers must only reach this for
+// sessions whose identity is already known to be an admin.
+func (q *QuizzServer) handleAdminCommand(reply io.Writer, line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+
+	switch auth.AdminCommand(fields[0]) {
+	case auth.CommandKick:
+		if len(fields) < 2 {
+			return
+		}
+		q.kickByKey(fields[1])
+	case auth.CommandBan:
+		if len(fields) < 2 {
+			return
+		}
+		q.banByKey(fields[1])
+	case auth.CommandChangeQuiz:
+		if len(fields) >= 2 {
+			if err := q.LoadFromFile(fields[1]); err != nil {
+				fmt.Fprintf(reply, "change-quiz: %v\r\n", err)
+			}
+			return
+		}
+
+		q.mux.Lock()
+		next := q.nextQuizz
+		q.mux.Unlock()
+		if next == nil {
+			return
+		}
+		if quizz := next(); quizz != nil {
+			q.SetQuizz(quizz)
+		}
+	case auth.CommandList:
+		reply.Write([]byte(q.sessionsList()))
+	}
+}
+
+// sessionsList returns one "key\tname" line per player session this
+// lobby holds, connected or not, for an admin to find the key to target
+// with kick/ban.
+func (q *QuizzServer) sessionsList() string {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	var b strings.Builder
+	for key, session := range q.Sessions {
+		fmt.Fprintf(&b, "%s\t%s\r\n", key, session.name())
+	}
+	return b.String()
+}
+
+// kickByKey disconnects the player identified by key (see
+// PlayerIdentity.Key), if one is currently connected to this lobby.
+func (q *QuizzServer) kickByKey(key string) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	session, ok := q.Sessions[key]
+	if !ok {
+		return
+	}
+	session.close()
+	delete(q.Sessions, key)
+}
+
+// banByKey bans the player identified by key (see PlayerIdentity.Key),
+// server-wide, not just this lobby, and disconnects them, if one is
+// currently connected to this lobby.
+func (q *QuizzServer) banByKey(key string) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	session, ok := q.Sessions[key]
+	if !ok {
+		return
+	}
+
+	banTarget := session.identity.Fingerprint
+	if banTarget == "" {
+		// Guest (keyboard-interactive) players carry no fingerprint;
+		// Authenticate checks bans against their remote IP instead.
+		banTarget = session.identity.RemoteAddr
+		if host, _, err := net.SplitHostPort(banTarget); err == nil {
+			banTarget = host
+		}
+	}
+	authStore.Ban(banTarget, 0)
+	session.close()
+	delete(q.Sessions, key)
+}
+
+// SubmitAnswer records key's answer to the question currently live, if
+// any: it is ignored outside stateQuestion, for an unknown session, for
+// an already-answered question, or for a key the question doesn't
+// offer. Correct answers score more the faster they come in.
+func (q *QuizzServer) SubmitAnswer(key string, answer AnswerKey) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.state != stateQuestion {
+		return
+	}
+	session, ok := q.Sessions[key]
+	if !ok {
+		return
+	}
+
+	question := q.currentQuizz.Questions[q.questionIndex]
+	if _, validKey := question.Answers[answer]; !validKey {
+		return
+	}
+
+	correct := answer == question.ValidAnswer
+	points := 0
+	result := "incorrect"
+	if correct {
+		points = scoreForAnswer(question.Timeout, time.Since(q.questionStartedAt))
+		result = "correct"
+	}
+	metrics.QuestionsAnswered.WithLabelValues(q.currentQuizz.Title, result).Inc()
+
+	session.recordAnswer(q.questionIndex, answer, correct, points)
+}
+
+// answerKeyForKeystroke maps the keystrokes players use to pick an
+// answer (a-d, case-insensitive, or 1-4) to the canonical AnswerKey
+// quiz definitions use.
+func answerKeyForKeystroke(b byte) (AnswerKey, bool) {
+	switch b {
+	case 'a', 'A', '1':
+		return "a", true
+	case 'b', 'B', '2':
+		return "b", true
+	case 'c', 'C', '3':
+		return "c", true
+	case 'd', 'D', '4':
+		return "d", true
+	default:
+		return "", false
+	}
+}
+
+// scoreForAnswer awards more points the earlier within timeout the
+// answer came in, down to a floor of minPoints for a last-instant
+// correct answer.
+func scoreForAnswer(timeout, elapsed time.Duration) int {
+	const basePoints = 1000
+	const minPoints = 100
+
+	if timeout <= 0 {
+		return basePoints
+	}
+
+	remaining := float64(timeout-elapsed) / float64(timeout)
+	if remaining < 0 {
+		remaining = 0
+	}
+	if remaining > 1 {
+		remaining = 1
+	}
+
+	return minPoints + int(remaining*float64(basePoints-minPoints))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/yageek/term-quizz/auth"
+)
+
+// nopChannel is a no-op io.ReadWriteCloser, good enough to back a
+// PlayerSession in tests that never touch its transport.
+type nopChannel struct{}
+
+func (nopChannel) Read(p []byte) (int, error)  { return 0, io.EOF }
+func (nopChannel) Write(p []byte) (int, error) { return len(p), nil }
+func (nopChannel) Close() error                { return nil }
+
+func TestScoreForAnswer(t *testing.T) {
+	cases := []struct {
+		name             string
+		timeout, elapsed time.Duration
+		want             int
+	}{
+		{"instant answer scores max", 10 * time.Second, 0, 1000},
+		{"last-instant answer scores floor", 10 * time.Second, 10 * time.Second, 100},
+		{"halfway answer scores midpoint", 10 * time.Second, 5 * time.Second, 550},
+		{"zero timeout always scores max", 0, 0, 1000},
+		{"elapsed past timeout clamps to floor", 10 * time.Second, 20 * time.Second, 100},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := scoreForAnswer(c.timeout, c.elapsed); got != c.want {
+				t.Errorf("scoreForAnswer(%v, %v) = %d, want %d", c.timeout, c.elapsed, got, c.want)
+			}
+		})
+	}
+}
+
+func TestAnswerKeyForKeystroke(t *testing.T) {
+	cases := []struct {
+		b      byte
+		want   AnswerKey
+		wantOk bool
+	}{
+		{'a', "a", true},
+		{'B', "b", true},
+		{'3', "c", true},
+		{'4', "d", true},
+		{'e', "", false},
+	}
+
+	for _, c := range cases {
+		got, ok := answerKeyForKeystroke(c.b)
+		if got != c.want || ok != c.wantOk {
+			t.Errorf("answerKeyForKeystroke(%q) = (%q, %v), want (%q, %v)", c.b, got, ok, c.want, c.wantOk)
+		}
+	}
+}
+
+// TestSetQuizzWithNoQuestionsEndsImmediately guards against the panic a
+// questionless quizz used to cause once the lobby countdown reached
+// startQuestion, which indexes Questions[0].
+func TestSetQuizzWithNoQuestionsEndsImmediately(t *testing.T) {
+	q := NewQuizzServer("test")
+	q.SetQuizz(&Quizz{Title: "Empty"})
+
+	q.mux.Lock()
+	state := q.state
+	q.mux.Unlock()
+
+	if state != stateEnded {
+		t.Fatalf("state = %v, want stateEnded for a quizz with no questions", state)
+	}
+}
+
+func TestAdvanceLobbyStartsFirstQuestionAfterCountdown(t *testing.T) {
+	q := NewQuizzServer("test")
+	q.SetQuizz(&Quizz{
+		Title:     "Quizz",
+		Questions: []Question{{Content: "Q", Answers: map[AnswerKey]string{"a": "x"}, ValidAnswer: "a", Timeout: 10 * time.Second}},
+	})
+	q.AddSession("player", NewPlayerSession(nopChannel{}, auth.PlayerIdentity{Fingerprint: "player"}, 24, 80))
+
+	now := time.Now()
+	q.mux.Lock()
+	q.advance(now)                                   // first tick with a player present starts the countdown
+	q.advance(now.Add(lobbyCountdown + time.Second)) // countdown elapsed
+	state := q.state
+	q.mux.Unlock()
+
+	if state != stateQuestion {
+		t.Fatalf("state = %v, want stateQuestion once the lobby countdown elapses", state)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+)
+
+// DefaultLobbyCode is used when a player connects without specifying a
+// lobby passphrase.
+const DefaultLobbyCode = "default"
+
+// LobbyManager routes players to the QuizzServer for their lobby,
+// creating lobbies on demand.
+type LobbyManager struct {
+	mux      sync.Mutex
+	lobbies  map[string]*QuizzServer
+	newQuizz func() *Quizz
+
+	// onCreate, if set, is called once for every newly created lobby,
+	// after its quizz is set but before it starts running - e.g. to wire
+	// up quiz chaining.
+	onCreate func(lobby *QuizzServer)
+}
+
+// NewLobbyManager returns an empty LobbyManager. newQuizz is called
+// once per lobby, the first time a player reaches it, to seed the quizz
+// that lobby starts on.
+func NewLobbyManager(newQuizz func() *Quizz) *LobbyManager {
+	return &LobbyManager{
+		lobbies:  make(map[string]*QuizzServer),
+		newQuizz: newQuizz,
+	}
+}
+
+// Lobby returns the QuizzServer for code, creating and starting one if
+// this is the first player to reach it.
+func (m *LobbyManager) Lobby(code string) *QuizzServer {
+	if code == "" {
+		code = DefaultLobbyCode
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	lobby, ok := m.lobbies[code]
+	if !ok {
+		lobby = NewQuizzServer(code)
+		lobby.SetQuizz(m.newQuizz())
+		if m.onCreate != nil {
+			m.onCreate(lobby)
+		}
+		lobby.Run()
+		m.lobbies[code] = lobby
+	}
+	return lobby
+}
+
+// All returns a snapshot of the lobbies currently running.
+func (m *LobbyManager) All() []*QuizzServer {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	lobbies := make([]*QuizzServer, 0, len(m.lobbies))
+	for _, lobby := range m.lobbies {
+		lobbies = append(lobbies, lobby)
+	}
+	return lobbies
+}
+
+// ParseLobbyCode splits an SSH username of the form "user+lobbycode"
+// into the bare username and the requested lobby code. When user
+// carries no "+", the lobby code is empty and the caller should fall
+// back to prompting the player or using the default lobby.
+func ParseLobbyCode(user string) (username, code string) {
+	if idx := strings.IndexByte(user, '+'); idx >= 0 {
+		return user[:idx], user[idx+1:]
+	}
+	return user, ""
+}
+
+// promptForLobbyCode asks the player, over their already-open channel,
+// which lobby they want to join. An empty reply joins the default
+// lobby. It is only used when the SSH username didn't already carry a
+// "+lobbycode" suffix.
+func promptForLobbyCode(channel io.ReadWriter) string {
+	channel.Write([]byte("Lobby code (leave empty for default): \r\n"))
+
+	reader := bufio.NewReader(channel)
+	line, err := reader.ReadString('\r')
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.Trim(line, "\r\n"))
+}
@@ -5,21 +5,37 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
-	"net"
 	"os"
+	"runtime"
+	"strings"
+	"time"
 
-	"golang.org/x/crypto/ssh"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/gliderlabs/ssh"
+
+	"github.com/yageek/term-quizz/auth"
+	"github.com/yageek/term-quizz/metrics"
+	"github.com/yageek/term-quizz/quizloader"
 )
 
 var (
-	sshPort   = flag.Int("sshPort", 2022, "The ssh port to use")
-	sshConfig = &ssh.ServerConfig{
-		NoClientAuth: true,
-	}
-	keyPath = flag.String("key", "", "The path to the SSH key")
-	server  *QuizzServer
+	sshPort     = flag.Int("sshPort", 2022, "The ssh port to use")
+	keyPath     = flag.String("key", "", "The path to the SSH key")
+	allowlist   = flag.String("allowlist", "", "Optional path to a file of authorized SSH key fingerprints")
+	adminFlags  = flag.String("admins", "", "Comma-separated list of admin SSH key fingerprints")
+	quizzesFlag = flag.String("quizzes", "", "Optional directory of quiz definitions (YAML/JSON) to load, with hot reload")
+	metricsAddr = flag.String("metricsAddr", "", "Optional address (e.g. :9090) to serve Prometheus metrics on")
+	pprofFlag   = flag.Bool("pprof", false, "Mount net/http/pprof under the metrics listener (requires -metricsAddr)")
+
+	authStore *auth.AuthStore
+	lobbies   *LobbyManager
 )
 
+// minReconnectInterval bounds how often a single player identity may
+// start a new session, to blunt connect/disconnect abuse.
+const minReconnectInterval = 500 * time.Millisecond
+
 func main() {
 	flag.Parse()
 
@@ -36,123 +52,77 @@ func main() {
 		log.Fatalln("Failed to load private key: ", err)
 	}
 
-	private, err := ssh.ParsePrivateKey(privateBytes)
+	private, err := gossh.ParsePrivateKey(privateBytes)
 	if err != nil {
 		log.Fatalln("Failed to parse private key: ", err)
 	}
 
-	sshConfig.AddHostKey(private)
-
-	// Stars a new quizz
-	server = NewQuizzServer()
-
-	quizz := &Quizz{
-		Title:      "Some Core Data",
-		Difficulty: 100,
-	}
-	server.SetQuizz(quizz)
-	server.Run()
-
-	// Starts TCP connection
-	address := fmt.Sprintf("0.0.0.0:%d", *sshPort)
-	fmt.Printf("Starting server at %s ... \n", address)
-	listener, err := net.Listen("tcp", address)
-	if err != nil {
-		log.Fatalln("Impossible to start connection")
+	var admins []string
+	if *adminFlags != "" {
+		admins = strings.Split(*adminFlags, ",")
 	}
-
-	for {
-		if newConnection, err := listener.Accept(); err != nil {
-			log.Fatalln("Impossible to accept incomming connection")
-		} else {
-			go handleNewConnection(newConnection)
+	authStore = auth.NewAuthStore(admins)
+	if *allowlist != "" {
+		if err := authStore.LoadAllowlist(*allowlist); err != nil {
+			log.Fatalln("Failed to load allowlist: ", err)
 		}
-
 	}
-}
 
-func handleNewConnection(conn net.Conn) {
+	library := newQuizLibrary(nil)
 
-	sshConn, chans, reqs, err := ssh.NewServerConn(conn, sshConfig)
-	if err != nil {
-		log.Fatalf("Impossible to start an ssh connection for %s: %v \n", conn.RemoteAddr(), err)
+	// Lobbies are created on demand, each seeded with its own copy of the
+	// starting quizz: the first quiz loaded from -quizzes if any, or the
+	// built-in placeholder otherwise.
+	lobbies = NewLobbyManager(func() *Quizz {
+		if quizz, err := library.template(); err == nil {
+			return quizz
+		}
+		return &Quizz{
+			Title:      "Some Core Data",
+			Difficulty: 100,
+		}
+	})
+	library.lobbies = lobbies
+
+	// Once -quizzes holds more than one quiz, chain each lobby from one
+	// to the next once its results screen has been shown.
+	lobbies.onCreate = func(lobby *QuizzServer) {
+		lobby.SetNextQuizz(func() *Quizz {
+			return library.next(lobby.QuizzTitle())
+		})
 	}
 
-	// See documentation
-	go ssh.DiscardRequests(reqs)
-
-	for newChannel := range chans {
-
-		if newChannel.ChannelType() != "session" {
-			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
-			continue
+	if *quizzesFlag != "" {
+		if err := library.loadDir(*quizzesFlag); err != nil {
+			log.Fatalln("Failed to load quizzes: ", err)
 		}
-
-		channel, requests, err := newChannel.Accept()
-		if err != nil {
-			log.Fatalf("Could not accept channel: %v", err)
+		if _, err := quizloader.Watch(*quizzesFlag, library.onChange); err != nil {
+			log.Fatalln("Failed to watch quizzes directory: ", err)
 		}
-
-		// Reject all out of band requests accept for the unix defaults, pty-req and
-		// shell.
-		go func(in <-chan *ssh.Request) {
-			for req := range in {
-
-				username := usernameFromConn(sshConn)
-
-				switch req.Type {
-				case "pty-req":
-
-					fmt.Printf("New session for: %s\n", username)
-					ptyRequest := ptyRequestMsg{}
-					if err := ssh.Unmarshal(req.Payload, &ptyRequest); err != nil {
-						fmt.Printf("New session err %s: %v \n", username, err)
-						req.Reply(false, nil)
-						continue
-					}
-
-					startNewSession(channel, username, 30, 80)
-					req.Reply(true, nil)
-
-				case "window-change":
-					request := windowsRequestMsg{}
-					if err := ssh.Unmarshal(req.Payload, &request); err != nil {
-						fmt.Printf("Windows update err %s: %v \n", username, err)
-					} else {
-						// server.UpdateWindowSize(username, int(request.RowsHeight), int(request.ColumnsWidth))
-					}
-					req.Reply(false, nil)
-				default:
-					fmt.Println("Default request:", req.Type)
-					req.Reply(true, nil)
-				}
-			}
-		}(requests)
-
 	}
-}
 
-func usernameFromConn(conn *ssh.ServerConn) string {
-	return fmt.Sprintf("%s_%s", conn.User(), conn.RemoteAddr().String())
-}
+	if *metricsAddr != "" {
+		if *pprofFlag {
+			// Disabled by default; turn sampling on so pprof's mutex/block
+			// profiles actually have something to show for QuizzServer.mux.
+			runtime.SetBlockProfileRate(1)
+			runtime.SetMutexProfileFraction(1)
+		}
+		go func() {
+			log.Fatalln("metrics server failed: ", metrics.Serve(*metricsAddr, *pprofFlag))
+		}()
+	}
 
-func startNewSession(channel ssh.Channel, username string, rows, columns uint32) {
-	go server.HandleUserConnection(channel, username, int(rows), int(columns))
-}
+	handler := withMiddleware(sessionHandler(lobbies), loggingMiddleware, rateLimitMiddleware(minReconnectInterval))
 
-// https://github.com/golang/crypto/blob/b080dc9a8c480b08e698fb1219160d598526310f/ssh/session.go#L179
-type ptyRequestMsg struct {
-	Term     string
-	Columns  uint32
-	Rows     uint32
-	Width    uint32
-	Height   uint32
-	Modelist string
-}
+	srv := &ssh.Server{
+		Addr:                       fmt.Sprintf("0.0.0.0:%d", *sshPort),
+		Handler:                    handler,
+		PublicKeyHandler:           publicKeyHandler(authStore),
+		KeyboardInteractiveHandler: keyboardInteractiveHandler(authStore),
+	}
+	srv.AddHostKey(private)
 
-type windowsRequestMsg struct {
-	ColumnsWidth uint32
-	RowsHeight   uint32
-	PixelWidth   uint32
-	PixelHeight  uint32
+	fmt.Printf("Starting server at %s ... \n", srv.Addr)
+	log.Fatal(srv.ListenAndServe())
 }
@@ -0,0 +1,53 @@
+// Package metrics holds the Prometheus collectors the rest of the
+// program updates, and the HTTP endpoint that exposes them.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// ActiveSessions is the number of SSH sessions currently connected,
+	// across every lobby.
+	ActiveSessions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "term_quizz_active_sessions",
+		Help: "Number of SSH sessions currently connected.",
+	})
+
+	// SessionsPerLobby is the number of SSH sessions currently connected
+	// to each lobby.
+	SessionsPerLobby = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "term_quizz_lobby_sessions",
+		Help: "Number of SSH sessions currently connected, by lobby code.",
+	}, []string{"lobby"})
+
+	// QuestionsAnswered counts questions answered, by quizz title and
+	// whether the answer was correct.
+	QuestionsAnswered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "term_quizz_questions_answered_total",
+		Help: "Number of questions answered, by quizz and result.",
+	}, []string{"quizz", "result"})
+
+	// SSHHandshakeFailures counts authentication attempts rejected by the
+	// public-key or keyboard-interactive handlers, before a session is
+	// ever established, one per rejected attempt.
+	SSHHandshakeFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "term_quizz_ssh_handshake_failures_total",
+		Help: "Number of SSH connections that failed to authenticate.",
+	})
+
+	// TickDuration observes how long a single QuizzServer.Update render
+	// tick takes, across every lobby.
+	TickDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "term_quizz_tick_duration_seconds",
+		Help:    "Duration of a QuizzServer.Update render tick.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	// BytesWritten counts bytes written to player sessions, by lobby code.
+	BytesWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "term_quizz_session_bytes_written_total",
+		Help: "Bytes written to player sessions, by lobby code.",
+	}, []string{"lobby"})
+)
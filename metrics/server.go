@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Serve starts an HTTP server on addr exposing the collectors above at
+// /metrics. When withPprof is set, it also mounts net/http/pprof's
+// profiles under /debug/pprof/, so the 60Hz render loop and
+// QuizzServer.mux contention can be profiled under load. It blocks
+// until the listener fails, like http.ListenAndServe.
+func Serve(addr string, withPprof bool) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	if withPprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"time"
+
+	"github.com/yageek/term-quizz/quizloader"
+)
+
+// quizzFromDefinition converts a quizloader.Quizz, as parsed from a
+// YAML/JSON file, into the Quizz type the game engine runs on.
+func quizzFromDefinition(def *quizloader.Quizz) *Quizz {
+	questions := make([]Question, len(def.Questions))
+	for i, q := range def.Questions {
+		answers := make(map[AnswerKey]string, len(q.Answers))
+		for key, text := range q.Answers {
+			answers[AnswerKey(key)] = text
+		}
+
+		questions[i] = Question{
+			Content:     q.Content,
+			Answers:     answers,
+			ValidAnswer: AnswerKey(q.ValidAnswer),
+			Timeout:     time.Duration(q.Timeout) * time.Second,
+		}
+	}
+
+	return &Quizz{
+		Title:      def.Title,
+		Difficulty: def.Difficulty,
+		Questions:  questions,
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/yageek/term-quizz/quizloader"
+)
+
+// quizLibrary holds the quizzes loaded from a -quizzes directory and
+// keeps them in sync with quizloader.Watch, pushing live edits to any
+// lobby currently running a quiz with the edited file's title.
+type quizLibrary struct {
+	mux     sync.Mutex
+	quizzes map[string]*Quizz // path -> quizz
+
+	lobbies *LobbyManager
+}
+
+func newQuizLibrary(lobbies *LobbyManager) *quizLibrary {
+	return &quizLibrary{
+		quizzes: make(map[string]*Quizz),
+		lobbies: lobbies,
+	}
+}
+
+// loadDir populates the library from every quiz file in dir.
+func (l *quizLibrary) loadDir(dir string) error {
+	defs, err := quizloader.LoadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	for path, def := range defs {
+		l.quizzes[path] = quizzFromDefinition(def)
+	}
+	return nil
+}
+
+// template returns a clone of the lexicographically-first loaded quiz,
+// used to seed lobbies created after startup.
+func (l *quizLibrary) template() (*Quizz, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	sortedPaths := l.sortedPathsLocked()
+	if len(sortedPaths) == 0 {
+		return nil, fmt.Errorf("quizlibrary: no quizzes loaded")
+	}
+	return l.quizzes[sortedPaths[0]].Clone(), nil
+}
+
+// next returns a clone of the quiz loaded right after the one titled
+// afterTitle, in path order, wrapping back to the first quiz. It
+// returns nil if fewer than two quizzes are loaded or afterTitle isn't
+// found, so callers can fall back to ending the quizz instead.
+func (l *quizLibrary) next(afterTitle string) *Quizz {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	sortedPaths := l.sortedPathsLocked()
+	if len(sortedPaths) < 2 {
+		return nil
+	}
+
+	for i, path := range sortedPaths {
+		if l.quizzes[path].Title == afterTitle {
+			next := sortedPaths[(i+1)%len(sortedPaths)]
+			return l.quizzes[next].Clone()
+		}
+	}
+	return nil
+}
+
+// sortedPathsLocked returns the library's paths in sorted order.
+// Callers must hold l.mux.
+func (l *quizLibrary) sortedPathsLocked() []string {
+	paths := make([]string, 0, len(l.quizzes))
+	for path := range l.quizzes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// onChange is passed to quizloader.Watch: it refreshes the library and
+// pushes the new quiz live to every lobby whose current quizz has the
+// same title as the new definition. Lobbies are matched by title only:
+// a lobby running this file under a title the edit changed is not
+// updated.
+func (l *quizLibrary) onChange(path string, def *quizloader.Quizz) {
+	quizz := quizzFromDefinition(def)
+
+	l.mux.Lock()
+	l.quizzes[path] = quizz
+	l.mux.Unlock()
+
+	for _, lobby := range l.lobbies.All() {
+		if lobby.QuizzTitle() == quizz.Title {
+			log.Printf("quizlibrary: reloading %q\n", quizz.Title)
+			lobby.SetQuizz(quizz.Clone())
+		}
+	}
+}
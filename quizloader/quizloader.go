@@ -0,0 +1,96 @@
+// Package quizloader reads Quizz definitions from YAML or JSON files on
+// disk, validates them, and can watch a directory for changes so
+// quizzes can be edited live without restarting the server.
+package quizloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AnswerKey identifies one of a question's possible answers (e.g. "a", "b").
+type AnswerKey string
+
+// Question is one question of a quiz definition as loaded from disk.
+// Timeout is expressed in whole seconds.
+type Question struct {
+	Content     string               `yaml:"content" json:"content"`
+	Answers     map[AnswerKey]string `yaml:"answers" json:"answers"`
+	ValidAnswer AnswerKey            `yaml:"validAnswer" json:"validAnswer"`
+	Timeout     int                  `yaml:"timeout" json:"timeout"`
+}
+
+// Quizz is a full quiz definition as loaded from disk.
+type Quizz struct {
+	Title      string     `yaml:"title" json:"title"`
+	Difficulty int        `yaml:"difficulty" json:"difficulty"`
+	Questions  []Question `yaml:"questions" json:"questions"`
+}
+
+// Load reads and validates a single Quizz definition from path. The
+// format, YAML or JSON, is chosen from the file extension.
+func Load(path string) (*Quizz, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("quizloader: failed to read %s: %w", path, err)
+	}
+
+	var quizz Quizz
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &quizz); err != nil {
+			return nil, fmt.Errorf("quizloader: failed to parse %s: %w", path, err)
+		}
+	case ".json":
+		if err := json.Unmarshal(data, &quizz); err != nil {
+			return nil, fmt.Errorf("quizloader: failed to parse %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("quizloader: unsupported extension %q for %s", ext, path)
+	}
+
+	if err := Validate(&quizz); err != nil {
+		return nil, fmt.Errorf("quizloader: %s: %w", path, err)
+	}
+
+	return &quizz, nil
+}
+
+// LoadDir loads and validates every .yaml, .yml and .json file directly
+// inside dir, keyed by their full path. It stops at the first invalid
+// file so a typo doesn't silently leave a quiz missing.
+func LoadDir(dir string) (map[string]*Quizz, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("quizloader: failed to read %s: %w", dir, err)
+	}
+
+	quizzes := make(map[string]*Quizz)
+	for _, entry := range entries {
+		if entry.IsDir() || !isQuizzFile(entry.Name()) {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		quizz, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		quizzes[path] = quizz
+	}
+	return quizzes, nil
+}
+
+func isQuizzFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
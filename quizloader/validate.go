@@ -0,0 +1,41 @@
+package quizloader
+
+import "fmt"
+
+// Validate checks a Quizz definition against the invariants the game
+// engine relies on: a title, at least one question, a positive timeout
+// per question, and a ValidAnswer that is one of that question's
+// Answers. Answer keys are a Go map, so uniqueness within a question is
+// structural and needs no separate check.
+func Validate(quizz *Quizz) error {
+	if quizz.Title == "" {
+		return fmt.Errorf("quizz has no title")
+	}
+	if len(quizz.Questions) == 0 {
+		return fmt.Errorf("quizz %q has no questions", quizz.Title)
+	}
+
+	for i, question := range quizz.Questions {
+		if err := validateQuestion(question); err != nil {
+			return fmt.Errorf("question %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateQuestion(question Question) error {
+	if question.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive, got %d", question.Timeout)
+	}
+	if len(question.Answers) == 0 {
+		return fmt.Errorf("answers must not be empty")
+	}
+	if question.ValidAnswer == "" {
+		return fmt.Errorf("validAnswer must not be empty")
+	}
+	if _, ok := question.Answers[question.ValidAnswer]; !ok {
+		return fmt.Errorf("validAnswer %q is not one of the answers", question.ValidAnswer)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package quizloader
+
+import "testing"
+
+func validQuizz() *Quizz {
+	return &Quizz{
+		Title: "Geography",
+		Questions: []Question{
+			{
+				Content:     "Capital of France?",
+				Answers:     map[AnswerKey]string{"a": "Paris", "b": "Lyon"},
+				ValidAnswer: "a",
+				Timeout:     10,
+			},
+		},
+	}
+}
+
+func TestValidateAccepsAWellFormedQuizz(t *testing.T) {
+	if err := Validate(validQuizz()); err != nil {
+		t.Fatalf("Validate(valid) = %v, want nil", err)
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	cases := []struct {
+		name   string
+		mutate func(*Quizz)
+	}{
+		{"no title", func(q *Quizz) { q.Title = "" }},
+		{"no questions", func(q *Quizz) { q.Questions = nil }},
+		{"non-positive timeout", func(q *Quizz) { q.Questions[0].Timeout = 0 }},
+		{"no answers", func(q *Quizz) { q.Questions[0].Answers = nil }},
+		{"empty validAnswer", func(q *Quizz) { q.Questions[0].ValidAnswer = "" }},
+		{"validAnswer not among answers", func(q *Quizz) { q.Questions[0].ValidAnswer = "z" }},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			quizz := validQuizz()
+			c.mutate(quizz)
+
+			if err := Validate(quizz); err == nil {
+				t.Fatalf("Validate(%s) = nil, want error", c.name)
+			}
+		})
+	}
+}
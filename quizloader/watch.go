@@ -0,0 +1,66 @@
+package quizloader
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher watches a directory of quiz definitions and invokes a
+// callback with the freshly loaded, validated Quizz whenever one of its
+// files is created or written.
+type Watcher struct {
+	watcher *fsnotify.Watcher
+}
+
+// Watch starts watching dir and calls onChange with the reloaded Quizz
+// every time one of its YAML/JSON files changes. Invalid edits are
+// logged and otherwise ignored, so a typo never takes a live quiz down.
+// Call Close when done.
+func Watch(dir string, onChange func(path string, quizz *Quizz)) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("quizloader: failed to start watcher: %w", err)
+	}
+	if err := fsw.Add(dir); err != nil {
+		fsw.Close()
+		return nil, fmt.Errorf("quizloader: failed to watch %s: %w", dir, err)
+	}
+
+	w := &Watcher{watcher: fsw}
+	go w.run(onChange)
+	return w, nil
+}
+
+func (w *Watcher) run(onChange func(path string, quizz *Quizz)) {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) == 0 || !isQuizzFile(event.Name) {
+				continue
+			}
+
+			quizz, err := Load(event.Name)
+			if err != nil {
+				log.Printf("quizloader: %v", err)
+				continue
+			}
+			onChange(event.Name, quizz)
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("quizloader: watch error: %v", err)
+		}
+	}
+}
+
+// Close stops the watcher.
+func (w *Watcher) Close() error {
+	return w.watcher.Close()
+}
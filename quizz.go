@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/fatih/color"
-	"golang.org/x/crypto/ssh"
+
+	"github.com/yageek/term-quizz/auth"
+	"github.com/yageek/term-quizz/metrics"
+	"github.com/yageek/term-quizz/quizloader"
 )
 
 var (
@@ -28,11 +32,19 @@ var (
 
 // PlayerSession handles all user session data
 type PlayerSession struct {
-	mux     sync.Mutex
-	channel ssh.Channel
-	name    string
-	answers map[AnswerKey]string
-	screen  *PlayerScreen
+	mux      sync.Mutex
+	channel  io.ReadWriteCloser
+	identity auth.PlayerIdentity
+	score    int
+	answers  map[int]playerAnswer // questionIndex -> answer given
+	screen   *PlayerScreen
+}
+
+// playerAnswer records what a player answered for one question, so it
+// isn't scored twice. The screen does not display it.
+type playerAnswer struct {
+	Key     AnswerKey
+	Correct bool
 }
 
 func (s *PlayerSession) UpdateWindows(rows, columns int) {
@@ -43,6 +55,77 @@ func (s *PlayerSession) UpdateWindows(rows, columns int) {
 	s.screen.Render()
 }
 
+// close closes the player's underlying transport, disconnecting them -
+// used to act on an admin's kick/ban command.
+func (s *PlayerSession) close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.channel.Close()
+}
+
+// Rebind attaches a freshly accepted session channel to an existing
+// PlayerSession, used when a returning player reconnects: their score
+// and answers are kept, only the transport changes.
+func (s *PlayerSession) Rebind(channel io.ReadWriteCloser) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.channel = channel
+}
+
+// resetForNewQuizz clears the score and answers accumulated on the
+// previous quizz, so a freshly (re)loaded quizz starts from zero.
+func (s *PlayerSession) resetForNewQuizz() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.score = 0
+	s.answers = make(map[int]playerAnswer)
+}
+
+// maxDisplayNameLength caps how much of a player's (attacker-controlled)
+// SSH username is ever shown, so a deliberately long username can't
+// overrun the fixed-width screen it's rendered into.
+const maxDisplayNameLength = 20
+
+// name returns the display name for this player: their SSH username,
+// falling back to their stable identity key, truncated to
+// maxDisplayNameLength.
+func (s *PlayerSession) name() string {
+	name := s.identity.Username
+	if name == "" {
+		name = s.identity.Key()
+	}
+	if len(name) > maxDisplayNameLength {
+		name = name[:maxDisplayNameLength]
+	}
+	return name
+}
+
+// recordAnswer stores the player's answer to questionIndex and credits
+// points if it hasn't already been answered.
+func (s *PlayerSession) recordAnswer(questionIndex int, key AnswerKey, correct bool, points int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, answered := s.answers[questionIndex]; answered {
+		return
+	}
+
+	s.answers[questionIndex] = playerAnswer{Key: key, Correct: correct}
+	s.score += points
+}
+
+// leaderboardEntry returns a read-only snapshot of this player's
+// standing, for use on PlayerScreen's leaderboard panel.
+func (s *PlayerSession) leaderboardEntry() LeaderboardEntry {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return LeaderboardEntry{Name: s.name(), Score: s.score}
+}
+
 type PlayerScreen struct {
 	Columns int
 	Rows    int
@@ -72,16 +155,70 @@ func (s *PlayerScreen) Render() string {
 	return buff.String()
 }
 
-func (s *PlayerScreen) Compute(quizz *Quizz) {
+func (s *PlayerScreen) Compute(snapshot GameSnapshot) {
 
 	// Questions Board
 	s.DrawRect(0, 0, 55, s.Rows-1, color.FgCyan)
 	//Title of the quizz
-	s.SetText(quizz.Title, 2, 2, color.FgHiRed, color.BgBlack)
+	s.SetText(snapshot.Quizz.Title, 2, 2, color.FgHiRed, color.BgBlack)
+	s.computeQuestionBoard(snapshot)
 
 	// Players Board
 	s.DrawRect(56, 0, s.Columns-1, s.Rows-1, color.FgHiYellow)
+	s.SetText("Leaderboard", 2, 58, color.FgHiYellow, color.BgBlack)
+	s.computeLeaderboard(snapshot.Leaderboard)
+}
 
+func (s *PlayerScreen) computeQuestionBoard(snapshot GameSnapshot) {
+	switch snapshot.State {
+	case stateLobby:
+		s.SetText("Waiting for players...", 4, 2, color.FgWhite, color.BgBlack)
+
+	case stateQuestion, stateReveal:
+		question := snapshot.Quizz.Questions[snapshot.QuestionIndex]
+
+		s.SetText(question.Content, 4, 2, color.FgWhite, color.BgBlack)
+		timeLeft := snapshot.TimeLeft
+		if timeLeft < 0 {
+			timeLeft = 0
+		}
+		s.SetText(fmt.Sprintf("Time left: %ds", int(timeLeft.Seconds())), 6, 2, color.FgYellow, color.BgBlack)
+
+		row := 8
+		for _, key := range sortedAnswerKeys(question.Answers) {
+			fg := color.FgWhite
+			if snapshot.State == stateReveal && key == question.ValidAnswer {
+				fg = color.FgHiGreen
+			}
+			s.SetText(fmt.Sprintf("%s) %s", key, question.Answers[key]), row, 2, fg, color.BgBlack)
+			row++
+		}
+
+	case stateEnded:
+		s.SetText("Quizz finished! Final results on the right.", 4, 2, color.FgHiGreen, color.BgBlack)
+	}
+}
+
+func (s *PlayerScreen) computeLeaderboard(leaderboard []LeaderboardEntry) {
+	for i, entry := range leaderboard {
+		row := 4 + i
+		if row > s.Rows-2 {
+			break
+		}
+		line := fmt.Sprintf("%d. %s - %d", i+1, entry.Name, entry.Score)
+		s.SetText(line, row, 58, color.FgWhite, color.BgBlack)
+	}
+}
+
+// sortedAnswerKeys returns a question's answer keys in a stable order,
+// so the board doesn't reshuffle from one render to the next.
+func sortedAnswerKeys(answers map[AnswerKey]string) []AnswerKey {
+	keys := make([]AnswerKey, 0, len(answers))
+	for key := range answers {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
 }
 
 func (s *PlayerScreen) DrawRect(topLeftX, topLeftY, bottomRightX, bottomRightY int, fg color.Attribute) {
@@ -127,12 +264,15 @@ func (s *PlayerScreen) DrawRect(topLeftX, topLeftY, bottomRightX, bottomRightY i
 
 func (s *PlayerScreen) SetText(text string, i, j int, fg, bg color.Attribute) {
 
-	if i > (s.Rows - 1) {
+	if i < 0 || i > s.Rows-1 {
+		return
+	}
+	if j < 0 || j > s.Columns-1 {
 		return
 	}
 
-	if i+len(text) > s.Columns-1 {
-		text = text[0 : len(text)-s.Columns]
+	if maxLen := s.Columns - j; len(text) > maxLen {
+		text = text[:maxLen]
 	}
 
 	clr := color.New(fg, bg)
@@ -143,26 +283,30 @@ func (s *PlayerScreen) SetText(text string, i, j int, fg, bg color.Attribute) {
 }
 
 // NewPlayerSession creates a new session
-func NewPlayerSession(channel ssh.Channel, name string, rows, columns int) *PlayerSession {
+func NewPlayerSession(channel io.ReadWriteCloser, identity auth.PlayerIdentity, rows, columns int) *PlayerSession {
 
 	return &PlayerSession{
-		channel: channel,
-		name:    name,
-		answers: make(map[AnswerKey]string),
-		screen:  NewPlayerScreen(rows, columns),
+		channel:  channel,
+		identity: identity,
+		answers:  make(map[int]playerAnswer),
+		screen:   NewPlayerScreen(rows, columns),
 	}
 }
 
-func (s *PlayerSession) Update(quizz *Quizz) {
+// Update renders snapshot to the player's channel, returning the number
+// of bytes written so callers can track it (e.g. for metrics).
+func (s *PlayerSession) Update(snapshot GameSnapshot) (int64, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
 
 	var buffer bytes.Buffer
-	s.screen.Compute(quizz)
+	s.screen.Compute(snapshot)
 
 	buffer.WriteString(clearScreen)
 	buffer.WriteString(s.screen.Render())
 	buffer.WriteString(hideCursor)
 
-	io.Copy(s.channel, &buffer)
+	return io.Copy(s.channel, &buffer)
 }
 
 // AnswerKey is the key for the answer
@@ -178,29 +322,56 @@ type Question struct {
 
 // Quizz is a set of questions
 type Quizz struct {
-	Title         string
-	Difficulty    int
-	Questions     []Question
-	questionIndex int
+	Title      string
+	Difficulty int
+	Questions  []Question
+}
+
+// Clone returns a copy of quizz whose Questions slice is independent of
+// the original. The copy is shallow: each Question's Answers map is
+// still shared with the original.
+func (q *Quizz) Clone() *Quizz {
+	questions := make([]Question, len(q.Questions))
+	copy(questions, q.Questions)
+
+	return &Quizz{
+		Title:      q.Title,
+		Difficulty: q.Difficulty,
+		Questions:  questions,
+	}
 }
 
 // A QuizzServer handling quizzes
 type QuizzServer struct {
 	mux          sync.Mutex
+	code         string // lobby code, used as a metrics label
 	currentQuizz *Quizz
 	Sessions     map[string]*PlayerSession
+
+	state             gameState
+	questionIndex     int
+	questionStartedAt time.Time
+	questionDeadline  time.Time
+	lobbyDeadline     time.Time
+	endedAt           time.Time
+
+	// nextQuizz, if set, supplies the quizz to chain to once the results
+	// screen has been shown for resultsDuration.
+	nextQuizz func() *Quizz
 }
 
-func (q *QuizzServer) AddSession(username string, session *PlayerSession) {
+func (q *QuizzServer) AddSession(key string, session *PlayerSession) {
 	q.mux.Lock()
 	defer q.mux.Unlock()
 
-	q.Sessions[username] = session
+	q.Sessions[key] = session
 }
 
-// NewQuizzServer returns a new game server
-func NewQuizzServer() *QuizzServer {
+// NewQuizzServer returns a new game server for the lobby identified by
+// code, used to label its metrics.
+func NewQuizzServer(code string) *QuizzServer {
 	return &QuizzServer{
+		code:     code,
 		Sessions: make(map[string]*PlayerSession),
 	}
 }
@@ -226,35 +397,115 @@ func (q *QuizzServer) Run() error {
 }
 
 func (q *QuizzServer) Update(delta float64) {
+	start := time.Now()
+	defer func() { metrics.TickDuration.Observe(time.Since(start).Seconds()) }()
 
+	now := start
+
+	q.mux.Lock()
+	q.advance(now)
+	snapshot := q.snapshotLocked(now)
+	sessions := make([]*PlayerSession, 0, len(q.Sessions))
 	for _, session := range q.Sessions {
-		session.Update(q.currentQuizz)
+		sessions = append(sessions, session)
+	}
+	q.mux.Unlock()
+
+	for _, session := range sessions {
+		n, err := session.Update(snapshot)
+		if err == nil {
+			metrics.BytesWritten.WithLabelValues(q.code).Add(float64(n))
+		}
 	}
 }
 
+// SetQuizz assigns the quizz this server plays next, resetting the
+// game state machine and every player's score so it starts fresh.
 func (q *QuizzServer) SetQuizz(quizz *Quizz) {
 	q.mux.Lock()
 	defer q.mux.Unlock()
 
-	//TODO: Clear previous quizz
+	q.setQuizzLocked(quizz)
+}
 
-	// Assign new elements
+func (q *QuizzServer) setQuizzLocked(quizz *Quizz) {
 	q.currentQuizz = quizz
+	q.questionIndex = 0
+	q.lobbyDeadline = time.Time{}
+	q.endedAt = time.Time{}
+
+	// A quizz with no questions can never reach startQuestion, which
+	// indexes Questions[0]: go straight to stateEnded so it just shows
+	// results (and chains to nextQuizz, if any) instead of crashing.
+	if quizz == nil || len(quizz.Questions) == 0 {
+		q.state = stateEnded
+		q.endedAt = time.Now()
+	} else {
+		q.state = stateLobby
+	}
+
+	for _, session := range q.Sessions {
+		session.resetForNewQuizz()
+	}
 }
 
-func (q *QuizzServer) HandleUserConnection(channel ssh.Channel, username string, rows, columns int) {
+// SetNextQuizz registers the quizz to chain to once the current one's
+// results screen has been shown, or clears the chain when fn is nil.
+func (q *QuizzServer) SetNextQuizz(fn func() *Quizz) {
 	q.mux.Lock()
 	defer q.mux.Unlock()
 
-	session := NewPlayerSession(channel, username, rows, columns)
-	q.Sessions[username] = session
+	q.nextQuizz = fn
+}
+
+// LoadFromFile replaces this server's quizz with the definition loaded
+// and validated from path (a YAML or JSON file understood by the
+// quizloader package).
+func (q *QuizzServer) LoadFromFile(path string) error {
+	def, err := quizloader.Load(path)
+	if err != nil {
+		return err
+	}
 
+	q.SetQuizz(quizzFromDefinition(def))
+	return nil
 }
 
-func (q *QuizzServer) UpdateWindowSize(username string, rows, columns int) {
-	session, ok := q.Sessions[username]
+// QuizzTitle returns the title of the quizz currently running, or ""
+// if none has been set yet.
+func (q *QuizzServer) QuizzTitle() string {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.currentQuizz == nil {
+		return ""
+	}
+	return q.currentQuizz.Title
+}
+
+func (q *QuizzServer) HandleUserConnection(channel io.ReadWriteCloser, identity auth.PlayerIdentity, rows, columns int) {
+	key := identity.Key()
+
+	q.mux.Lock()
+	if existing, ok := q.Sessions[key]; ok {
+		// Returning player: keep their score/answers, just rebind the
+		// transport and redraw at the new terminal size.
+		existing.Rebind(channel)
+		existing.UpdateWindows(rows, columns)
+	} else {
+		q.Sessions[key] = NewPlayerSession(channel, identity, rows, columns)
+	}
+	q.mux.Unlock()
+
+	go q.readAnswers(key, identity.Admin, channel)
+}
+
+func (q *QuizzServer) UpdateWindowSize(key string, rows, columns int) {
+	q.mux.Lock()
+	session, ok := q.Sessions[key]
+	q.mux.Unlock()
+
 	if ok {
-		fmt.Printf("Update windows for %s \n", username)
 		session.UpdateWindows(rows, columns)
 	}
 }
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/gliderlabs/ssh"
+
+	"github.com/yageek/term-quizz/auth"
+	"github.com/yageek/term-quizz/metrics"
+)
+
+// contextKey namespaces the values this package stashes on an
+// ssh.Context during authentication.
+type contextKey string
+
+const (
+	fingerprintContextKey contextKey = "fingerprint"
+	passphraseContextKey  contextKey = "passphrase"
+	adminContextKey       contextKey = "admin"
+)
+
+// Middleware wraps an ssh.Handler with extra behaviour, mirroring
+// gliderlabs/ssh's own Handler/Option pattern.
+type Middleware func(ssh.Handler) ssh.Handler
+
+// withMiddleware applies mws to handler in order, so the first
+// middleware is the outermost one to run.
+func withMiddleware(handler ssh.Handler, mws ...Middleware) ssh.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+	return handler
+}
+
+// loggingMiddleware logs the start and end of every session.
+func loggingMiddleware(next ssh.Handler) ssh.Handler {
+	return func(s ssh.Session) {
+		identity := identityFromSession(s)
+		log.Printf("session start: %s\n", identity.Key())
+		next(s)
+		log.Printf("session end: %s\n", identity.Key())
+	}
+}
+
+// rateLimiter rejects a player's session if they try to reconnect
+// faster than minInterval, to keep a single abusive client from
+// hammering the server with connect/disconnect cycles.
+type rateLimiter struct {
+	mux         sync.Mutex
+	minInterval time.Duration
+	lastSeen    map[string]time.Time
+}
+
+func newRateLimiter(minInterval time.Duration) *rateLimiter {
+	return &rateLimiter{
+		minInterval: minInterval,
+		lastSeen:    make(map[string]time.Time),
+	}
+}
+
+func (r *rateLimiter) allow(key string) bool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	now := time.Now()
+	if last, ok := r.lastSeen[key]; ok && now.Sub(last) < r.minInterval {
+		return false
+	}
+	r.lastSeen[key] = now
+	return true
+}
+
+// rateLimitMiddleware rejects sessions that reconnect faster than
+// minInterval, identified by their PlayerIdentity key.
+func rateLimitMiddleware(minInterval time.Duration) Middleware {
+	limiter := newRateLimiter(minInterval)
+
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			identity := identityFromSession(s)
+			if !limiter.allow(identity.Key()) {
+				s.Write([]byte("Too many reconnect attempts, please slow down.\r\n"))
+				s.Exit(1)
+				return
+			}
+			next(s)
+		}
+	}
+}
+
+// publicKeyHandler adapts an auth.AuthStore to gliderlabs/ssh's
+// PublicKeyHandler, stashing the fingerprint (and admin status) on the
+// connection's Context for later retrieval by identityFromSession.
+func publicKeyHandler(store *auth.AuthStore) ssh.PublicKeyHandler {
+	return func(ctx ssh.Context, key ssh.PublicKey) bool {
+		fingerprint := gossh.FingerprintSHA256(key)
+		if !store.Authenticate(fingerprint, ctx.User(), ctx.RemoteAddr().String()) {
+			metrics.SSHHandshakeFailures.Inc()
+			return false
+		}
+
+		ctx.SetValue(fingerprintContextKey, fingerprint)
+		ctx.SetValue(adminContextKey, store.IsAdmin(fingerprint))
+		return true
+	}
+}
+
+// keyboardInteractiveHandler is the no-auth fallback for players with no
+// SSH keypair configured: it prompts for a passphrase and accepts any
+// non-empty one as-is, stashing it on the connection's Context so identityFromSession
+// can key the player's identity on it instead of a fingerprint. It
+// always refuses once an allowlist is in use, since there's no
+// fingerprint to check the allowlist against, and still honours bans on
+// the username/remote address.
+func keyboardInteractiveHandler(store *auth.AuthStore) ssh.KeyboardInteractiveHandler {
+	return func(ctx ssh.Context, challenger gossh.KeyboardInteractiveChallenge) bool {
+		if store.AllowlistEnabled() {
+			return false
+		}
+		if !store.Authenticate("", ctx.User(), ctx.RemoteAddr().String()) {
+			metrics.SSHHandshakeFailures.Inc()
+			return false
+		}
+
+		answers, err := challenger("", "No SSH key found - enter any passphrase to continue as a guest.\r\n", []string{"Passphrase: "}, []bool{false})
+		if err != nil || len(answers) == 0 || answers[0] == "" {
+			metrics.SSHHandshakeFailures.Inc()
+			return false
+		}
+
+		ctx.SetValue(passphraseContextKey, answers[0])
+		return true
+	}
+}
+
+// identityFromSession builds a PlayerIdentity out of the fingerprint (or
+// guest passphrase) and admin flag the auth handlers stashed on the
+// session's Context.
+func identityFromSession(s ssh.Session) auth.PlayerIdentity {
+	ctx := s.Context()
+
+	identity := auth.PlayerIdentity{
+		Username:   s.User(),
+		RemoteAddr: s.RemoteAddr().String(),
+	}
+
+	if fingerprint, ok := ctx.Value(fingerprintContextKey).(string); ok {
+		identity.Fingerprint = fingerprint
+	}
+	if passphrase, ok := ctx.Value(passphraseContextKey).(string); ok {
+		identity.Passphrase = passphrase
+	}
+	if admin, ok := ctx.Value(adminContextKey).(bool); ok {
+		identity.Admin = admin
+	}
+
+	return identity
+}
+
+// sessionHandler is the ssh.Handler driving the quizz: it resolves the
+// player's lobby, hands their channel to the right QuizzServer, and
+// keeps that lobby's view of the terminal size in sync as it's resized.
+func sessionHandler(lobbies *LobbyManager) ssh.Handler {
+	return func(s ssh.Session) {
+		pty, windowChanges, isPty := s.Pty()
+		if !isPty {
+			s.Write([]byte("term-quizz requires a PTY\r\n"))
+			s.Exit(1)
+			return
+		}
+
+		identity := identityFromSession(s)
+
+		_, code := ParseLobbyCode(s.User())
+		if code == "" {
+			code = promptForLobbyCode(s)
+		}
+		lobby := lobbies.Lobby(code)
+		code = lobby.code // normalized, e.g. "" becomes DefaultLobbyCode
+
+		metrics.ActiveSessions.Inc()
+		metrics.SessionsPerLobby.WithLabelValues(code).Inc()
+		defer metrics.ActiveSessions.Dec()
+		defer metrics.SessionsPerLobby.WithLabelValues(code).Dec()
+
+		lobby.HandleUserConnection(s, identity, pty.Window.Height, pty.Window.Width)
+
+		for win := range windowChanges {
+			lobby.UpdateWindowSize(identity.Key(), win.Height, win.Width)
+		}
+	}
+}